@@ -5,6 +5,9 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -22,8 +25,24 @@ const (
 	PrivateAccess   AccessMode = "private"
 	NegotiateAccess AccessMode = "negotiate"
 	NTLMAccess      AccessMode = "ntlm"
-	emptyAccess     AccessMode = ""
-	defaultRemote              = "origin"
+	// LocalAccess is returned by AccessFor for file:// and bare local-path
+	// endpoints, signaling that the transfer queue should use the built-in
+	// standalone-file agent instead of HTTP. Producing this mode is lfsapi's
+	// job; the agent itself (the stdin/stdout JSON transfer protocol, the
+	// oid[0:2]/oid[2:4]/oid mirror layout, atomic rename, size verification,
+	// GIT_LFS_PROGRESS) is a separate transfer-queue/commands concern and
+	// isn't implemented by this mode existing.
+	LocalAccess AccessMode = "local"
+	// PureSSHAccess is returned by AccessFor when lfs.<url>.access is set to
+	// "ssh", requesting the pure-SSH protocol (git-lfs-transfer) instead of
+	// the usual SSH-to-HTTPS handoff via SshAuthResponse. This is config
+	// recognition only: dispatching batch/object requests over a persistent
+	// SSH channel instead of per-object HTTP calls requires a SSHTransport
+	// endpoint flag and a transport multiplexer that don't live in lfsapi,
+	// and aren't implemented by this mode existing.
+	PureSSHAccess AccessMode = "ssh"
+	emptyAccess   AccessMode = ""
+	defaultRemote            = "origin"
 )
 
 type Access struct {
@@ -44,10 +63,12 @@ type EndpointFinder interface {
 	NewEndpointFromCloneURL(operation, rawurl string) lfshttp.Endpoint
 	NewEndpoint(operation, rawurl string) lfshttp.Endpoint
 	Endpoint(operation, remote string) lfshttp.Endpoint
+	Endpoints(operation, remote string) []lfshttp.Endpoint
 	RemoteEndpoint(operation, remote string) lfshttp.Endpoint
 	GitRemoteURL(remote string, forpush bool) string
 	AccessFor(rawurl string) Access
 	SetAccess(access Access)
+	Reprobe(access Access, wwwAuthenticate []string) (Access, bool)
 	GitProtocol() string
 }
 
@@ -56,8 +77,9 @@ type endpointGitFinder struct {
 	gitEnv      config.Environment
 	gitProtocol string
 
-	aliasMu sync.Mutex
-	aliases map[string]string
+	aliasMu     sync.Mutex
+	aliases     map[string]string
+	pushAliases map[string]string
 
 	accessMu  sync.Mutex
 	urlAccess map[string]AccessMode
@@ -74,6 +96,7 @@ func NewEndpointFinder(ctx lfshttp.Context) EndpointFinder {
 		gitEnv:      ctx.GitEnv(),
 		gitProtocol: "https",
 		aliases:     make(map[string]string),
+		pushAliases: make(map[string]string),
 		urlAccess:   make(map[string]AccessMode),
 	}
 
@@ -86,10 +109,81 @@ func NewEndpointFinder(ctx lfshttp.Context) EndpointFinder {
 	return e
 }
 
+// Endpoint returns the canonical endpoint for operation/remote: the first
+// entry of Endpoints.
 func (e *endpointGitFinder) Endpoint(operation, remote string) lfshttp.Endpoint {
-	ep := e.getEndpoint(operation, remote)
-	ep.Operation = operation
-	return ep
+	return e.Endpoints(operation, remote)[0]
+}
+
+// Endpoints returns every endpoint configured for operation/remote, in the
+// order the batch/transfer queue should try them. The first entry is always
+// the canonical endpoint that Endpoint returns; any lfs.url.<n> or
+// lfs.mirror.<n> config keys are appended afterwards as read-only mirror
+// fallbacks for the transfer queue to fan downloads across, since uploads
+// must always land on the single canonical origin.
+func (e *endpointGitFinder) Endpoints(operation, remote string) []lfshttp.Endpoint {
+	primary := e.getEndpoint(operation, remote)
+	primary.Operation = operation
+	endpoints := []lfshttp.Endpoint{primary}
+
+	if operation == "upload" {
+		return endpoints
+	}
+
+	for _, rawurl := range e.mirrorUrls() {
+		ep := e.NewEndpoint(operation, rawurl)
+		if len(ep.Url) == 0 || ep.Url == primary.Url {
+			continue
+		}
+		ep.Operation = operation
+		endpoints = append(endpoints, ep)
+	}
+
+	return endpoints
+}
+
+// mirrorUrls collects fallback endpoint URLs configured via lfs.url.<n> or
+// lfs.mirror.<n> keys, ordered by ascending index.
+func (e *endpointGitFinder) mirrorUrls() []string {
+	if e.gitEnv == nil {
+		return nil
+	}
+	return mirrorUrlsFromConfig(e.gitEnv.All())
+}
+
+// mirrorUrlsFromConfig is the pure lookup behind mirrorUrls, split out so it
+// can be tested without a git.Configuration/config.Environment fixture.
+func mirrorUrlsFromConfig(all map[string][]string) []string {
+	type indexedUrl struct {
+		index int
+		url   string
+	}
+
+	var found []indexedUrl
+	for gitkey, gitval := range all {
+		if len(gitval) == 0 {
+			continue
+		}
+
+		for _, prefix := range []string{"lfs.url.", "lfs.mirror."} {
+			if !strings.HasPrefix(gitkey, prefix) {
+				continue
+			}
+			idx, err := strconv.Atoi(gitkey[len(prefix):])
+			if err != nil {
+				continue
+			}
+			found = append(found, indexedUrl{index: idx, url: gitval[len(gitval)-1]})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].index < found[j].index })
+
+	urls := make([]string, 0, len(found))
+	for _, f := range found {
+		urls = append(urls, f.url)
+	}
+	return urls
 }
 
 func (e *endpointGitFinder) getEndpoint(operation, remote string) lfshttp.Endpoint {
@@ -169,6 +263,13 @@ func (e *endpointGitFinder) NewEndpointFromCloneURL(operation, rawurl string) lf
 		return ep
 	}
 
+	if isLocalEndpointUrl(rawurl) {
+		// Local and file:// remotes are mirror directories maintained by
+		// the standalone-file transfer agent, not bare git repositories,
+		// so they don't get an info/lfs suffix appended.
+		return ep
+	}
+
 	if strings.HasSuffix(rawurl, "/") {
 		ep.Url = rawurl[0 : len(rawurl)-1]
 	}
@@ -184,7 +285,7 @@ func (e *endpointGitFinder) NewEndpointFromCloneURL(operation, rawurl string) lf
 }
 
 func (e *endpointGitFinder) NewEndpoint(operation, rawurl string) lfshttp.Endpoint {
-	rawurl = e.ReplaceUrlAlias(rawurl)
+	rawurl = e.ReplaceUrlAlias(operation, rawurl)
 	if strings.HasPrefix(rawurl, "/") {
 		return lfshttp.EndpointFromLocalPath(rawurl)
 	}
@@ -198,6 +299,8 @@ func (e *endpointGitFinder) NewEndpoint(operation, rawurl string) lfshttp.Endpoi
 		return lfshttp.EndpointFromSshUrl(u)
 	case "http", "https":
 		return lfshttp.EndpointFromHttpUrl(u)
+	case "file":
+		return lfshttp.EndpointFromLocalPath(localPathFromFileUrl(u))
 	case "git":
 		return endpointFromGitUrl(u, e)
 	case "":
@@ -219,6 +322,10 @@ func (e *endpointGitFinder) NewEndpoint(operation, rawurl string) lfshttp.Endpoi
 func (e *endpointGitFinder) AccessFor(rawurl string) Access {
 	accessurl := urlWithoutAuth(rawurl)
 
+	if isLocalEndpointUrl(accessurl) {
+		return Access{mode: LocalAccess, url: accessurl}
+	}
+
 	if e.gitEnv == nil {
 		return Access{mode: NoneAccess, url: accessurl}
 	}
@@ -251,6 +358,81 @@ func (e *endpointGitFinder) SetAccess(access Access) {
 	}
 }
 
+// Reprobe inspects the WWW-Authenticate challenges from a 401 response and,
+// if they call for a different access mode than access is currently using,
+// upgrades or downgrades it with Access.Upgrade and persists the result via
+// SetAccess, returning the new Access with ok=true. When the mode is
+// unchanged it returns access as given with ok=false. Reprobe only updates
+// the cached and configured mode: it sends no request and does not retry
+// the request that got the 401.
+func (e *endpointGitFinder) Reprobe(access Access, wwwAuthenticate []string) (Access, bool) {
+	newMode, ok := NextAccessMode(access.Mode(), wwwAuthenticate)
+	if !ok {
+		return access, false
+	}
+
+	upgraded := access.Upgrade(newMode)
+	e.SetAccess(upgraded)
+	return upgraded, true
+}
+
+// NextAccessMode decides, from the WWW-Authenticate challenges on a 401
+// response, what access mode a request should be retried with given the
+// mode it was cached with. It reports ok=false when none of the challenges
+// call for a different mode than current.
+//
+// A Negotiate challenge always wins, since it's offered alongside Basic/NTLM
+// as a fallback and a server that advertises it expects SPNEGO. Losing
+// Negotiate in favor of Basic is only honored when current was already
+// Negotiate, mirroring a server that has been migrated away from it.
+func NextAccessMode(current AccessMode, wwwAuthenticate []string) (AccessMode, bool) {
+	var hasNegotiate, hasBasic, hasNTLM bool
+	for _, challenge := range wwwAuthenticate {
+		scheme := challenge
+		if i := strings.IndexByte(challenge, ' '); i >= 0 {
+			scheme = challenge[:i]
+		}
+
+		switch strings.ToLower(scheme) {
+		case "negotiate":
+			hasNegotiate = true
+		case "basic":
+			hasBasic = true
+		case "ntlm":
+			hasNTLM = true
+		}
+	}
+
+	switch {
+	case hasNegotiate && current != NegotiateAccess:
+		return NegotiateAccess, true
+	case current == NegotiateAccess && !hasNegotiate && hasBasic:
+		return BasicAccess, true
+	case hasNTLM && current != NTLMAccess && !hasNegotiate:
+		return NTLMAccess, true
+	}
+
+	return current, false
+}
+
+// isLocalEndpointUrl reports whether rawurl refers to a file:// or bare
+// local-path LFS endpoint. NewEndpointFromCloneURL leaves these alone rather
+// than rewriting them as it would a remote git URL, and AccessFor reports
+// LocalAccess for them; see LocalAccess for what that mode does and doesn't
+// cover.
+func isLocalEndpointUrl(rawurl string) bool {
+	return strings.HasPrefix(rawurl, "/") || strings.HasPrefix(rawurl, "file://")
+}
+
+// localPathFromFileUrl converts a file:// URL into the plain filesystem path
+// expected by lfshttp.EndpointFromLocalPath.
+func localPathFromFileUrl(u *url.URL) string {
+	if len(u.Host) > 0 && u.Host != "localhost" {
+		return u.Host + u.Path
+	}
+	return u.Path
+}
+
 func urlWithoutAuth(rawurl string) string {
 	if !strings.Contains(rawurl, "@") {
 		return rawurl
@@ -268,28 +450,107 @@ func urlWithoutAuth(rawurl string) string {
 
 func (e *endpointGitFinder) fetchGitAccess(rawurl string) AccessMode {
 	if v, _ := e.urlConfig.Get("lfs", rawurl, "access"); len(v) > 0 {
-		access := AccessMode(strings.ToLower(v))
-		if access == PrivateAccess {
-			return BasicAccess
-		}
-		return access
+		return normalizeAccessMode(v)
+	}
+
+	if v, ok := e.globGitAccess(rawurl); ok {
+		return normalizeAccessMode(v)
 	}
+
 	return NoneAccess
 }
 
+func normalizeAccessMode(v string) AccessMode {
+	switch access := AccessMode(strings.ToLower(v)); access {
+	case PrivateAccess:
+		return BasicAccess
+	case PureSSHAccess:
+		return PureSSHAccess
+	default:
+		return access
+	}
+}
+
+// globGitAccess checks lfs.<pattern>.access config keys whose pattern
+// contains a glob wildcard, e.g. "lfs.https://*.corp.example.com/.access",
+// against rawurl. config.URLConfig only matches literal prefixes, so hosts
+// that vary across many repos need this instead of one entry per host.
+func (e *endpointGitFinder) globGitAccess(rawurl string) (string, bool) {
+	const prefix, suffix = "lfs.", ".access"
+
+	var best string
+	var bestLen int
+	for gitkey, gitval := range e.gitEnv.All() {
+		if len(gitval) == 0 || !strings.HasPrefix(gitkey, prefix) || !strings.HasSuffix(gitkey, suffix) {
+			continue
+		}
+
+		pattern := gitkey[len(prefix) : len(gitkey)-len(suffix)]
+		if !strings.Contains(pattern, "*") {
+			continue
+		}
+
+		if matchesUrlPattern(pattern, rawurl) && len(pattern) > bestLen {
+			best = gitval[len(gitval)-1]
+			bestLen = len(pattern)
+		}
+	}
+
+	return best, bestLen > 0
+}
+
+// matchesUrlPattern reports whether rawurl starts with pattern, where "*" in
+// pattern matches any run of characters, including "/". path.Match is wrong
+// here: it requires a full match and treats "/" as a path-element boundary
+// that "*" can't cross, so a pattern like "https://*.corp.example.com/"
+// would never match a real endpoint URL such as
+// "https://foo.corp.example.com/repo.git/info/lfs", which always has extra
+// path beyond the host. lfs.<pattern>.access uses prefix matching like the
+// rest of config.URLConfig, so the compiled pattern is intentionally
+// anchored only at the start.
+func matchesUrlPattern(pattern, rawurl string) bool {
+	parts := strings.Split(pattern, "*")
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		quoted[i] = regexp.QuoteMeta(part)
+	}
+
+	re, err := regexp.Compile("^" + strings.Join(quoted, ".*"))
+	if err != nil {
+		return false
+	}
+	return re.MatchString(rawurl)
+}
+
 func (e *endpointGitFinder) GitProtocol() string {
 	return e.gitProtocol
 }
 
 // ReplaceUrlAlias returns a url with a prefix from a `url.*.insteadof` git
-// config setting. If multiple aliases match, use the longest one.
+// config setting. If the operation is an upload, `url.*.pushinsteadof` is
+// tried first, matching Git's own push URL rewriting. If multiple aliases
+// match within either set, use the longest one.
 // See https://git-scm.com/docs/git-config for Git's docs.
-func (e *endpointGitFinder) ReplaceUrlAlias(rawurl string) string {
+func (e *endpointGitFinder) ReplaceUrlAlias(operation, rawurl string) string {
 	e.aliasMu.Lock()
 	defer e.aliasMu.Unlock()
 
+	if operation == "upload" {
+		if aliased, ok := replaceLongestAlias(e.pushAliases, rawurl); ok {
+			return aliased
+		}
+	}
+
+	if aliased, ok := replaceLongestAlias(e.aliases, rawurl); ok {
+		return aliased
+	}
+
+	return rawurl
+}
+
+func replaceLongestAlias(aliases map[string]string, rawurl string) (string, bool) {
 	var longestalias string
-	for alias, _ := range e.aliases {
+	for alias := range aliases {
 		if !strings.HasPrefix(rawurl, alias) {
 			continue
 		}
@@ -299,24 +560,31 @@ func (e *endpointGitFinder) ReplaceUrlAlias(rawurl string) string {
 		}
 	}
 
-	if len(longestalias) > 0 {
-		return e.aliases[longestalias] + rawurl[len(longestalias):]
+	if len(longestalias) == 0 {
+		return rawurl, false
 	}
 
-	return rawurl
+	return aliases[longestalias] + rawurl[len(longestalias):], true
 }
 
 const (
-	aliasPrefix = "url."
+	aliasPrefix         = "url."
+	insteadOfSuffix     = ".insteadof"
+	pushInsteadOfSuffix = ".pushinsteadof"
 )
 
 func initAliases(e *endpointGitFinder, git config.Environment) {
-	suffix := ".insteadof"
 	for gitkey, gitval := range git.All() {
-		if len(gitval) == 0 || !(strings.HasPrefix(gitkey, aliasPrefix) && strings.HasSuffix(gitkey, suffix)) {
+		if len(gitval) == 0 || !strings.HasPrefix(gitkey, aliasPrefix) {
 			continue
 		}
-		storeAlias(e.aliases, gitkey, gitval, suffix)
+
+		switch {
+		case strings.HasSuffix(gitkey, pushInsteadOfSuffix):
+			storeAlias(e.pushAliases, gitkey, gitval, pushInsteadOfSuffix)
+		case strings.HasSuffix(gitkey, insteadOfSuffix):
+			storeAlias(e.aliases, gitkey, gitval, insteadOfSuffix)
+		}
 	}
 }
 
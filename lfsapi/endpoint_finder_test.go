@@ -0,0 +1,156 @@
+package lfsapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchesUrlPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rawurl  string
+		match   bool
+	}{
+		{"https://*.corp.example.com/", "https://foo.corp.example.com/repo.git/info/lfs", true},
+		{"https://*.corp.example.com/", "https://foo.corp.example.com/", true},
+		{"https://*.corp.example.com/", "https://example.com/repo.git/info/lfs", false},
+		{"https://example.com/*", "https://example.com/a/b/info/lfs", true},
+		{"https://example.com/*", "https://example.com/", true},
+		{"*", "https://example.com/a/b/info/lfs", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchesUrlPattern(tt.pattern, tt.rawurl); got != tt.match {
+			t.Errorf("matchesUrlPattern(%q, %q) = %v, want %v", tt.pattern, tt.rawurl, got, tt.match)
+		}
+	}
+}
+
+func TestAccessForLocalEndpoint(t *testing.T) {
+	e := &endpointGitFinder{}
+
+	tests := []struct {
+		rawurl string
+		want   AccessMode
+	}{
+		{"file:///srv/mirror/repo.git", LocalAccess},
+		{"/srv/mirror/repo.git", LocalAccess},
+		{"https://example.com/repo.git/info/lfs", NoneAccess},
+	}
+
+	for _, tt := range tests {
+		access := e.AccessFor(tt.rawurl)
+		if got := access.Mode(); got != tt.want {
+			t.Errorf("AccessFor(%q).Mode() = %q, want %q", tt.rawurl, got, tt.want)
+		}
+	}
+}
+
+func TestMirrorUrlsFromConfig(t *testing.T) {
+	all := map[string][]string{
+		"lfs.url.2":       {"https://mirror-b.example.com"},
+		"lfs.mirror.0":    {"https://mirror-a.example.com"},
+		"lfs.url.1":       {"https://mirror-c.example.com"},
+		"lfs.url.notanum": {"https://ignored.example.com"},
+		"lfs.other":       {"https://ignored-too.example.com"},
+	}
+
+	got := mirrorUrlsFromConfig(all)
+	want := []string{
+		"https://mirror-a.example.com",
+		"https://mirror-c.example.com",
+		"https://mirror-b.example.com",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mirrorUrlsFromConfig() = %v, want %v", got, want)
+	}
+}
+
+func TestMirrorUrlsFromConfigEmpty(t *testing.T) {
+	if got := mirrorUrlsFromConfig(nil); len(got) != 0 {
+		t.Errorf("mirrorUrlsFromConfig(nil) = %v, want empty", got)
+	}
+}
+
+func TestNormalizeAccessMode(t *testing.T) {
+	tests := []struct {
+		v    string
+		want AccessMode
+	}{
+		{"ssh", PureSSHAccess},
+		{"SSH", PureSSHAccess},
+		{"private", BasicAccess},
+		{"negotiate", NegotiateAccess},
+		{"basic", BasicAccess},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeAccessMode(tt.v); got != tt.want {
+			t.Errorf("normalizeAccessMode(%q) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestNextAccessMode(t *testing.T) {
+	tests := []struct {
+		name            string
+		current         AccessMode
+		wwwAuthenticate []string
+		wantMode        AccessMode
+		wantOk          bool
+	}{
+		{
+			name:            "negotiate offered upgrades from none",
+			current:         NoneAccess,
+			wwwAuthenticate: []string{"Negotiate", "Basic realm=\"example\""},
+			wantMode:        NegotiateAccess,
+			wantOk:          true,
+		},
+		{
+			name:            "negotiate downgrades to basic once server drops it",
+			current:         NegotiateAccess,
+			wwwAuthenticate: []string{"Basic realm=\"example\""},
+			wantMode:        BasicAccess,
+			wantOk:          true,
+		},
+		{
+			name:            "basic alone never downgrades a non-negotiate mode",
+			current:         BasicAccess,
+			wwwAuthenticate: []string{"Basic realm=\"example\""},
+			wantMode:        BasicAccess,
+			wantOk:          false,
+		},
+		{
+			name:            "ntlm offered upgrades from none",
+			current:         NoneAccess,
+			wwwAuthenticate: []string{"NTLM"},
+			wantMode:        NTLMAccess,
+			wantOk:          true,
+		},
+		{
+			name:            "already matching mode is a no-op",
+			current:         NegotiateAccess,
+			wwwAuthenticate: []string{"Negotiate"},
+			wantMode:        NegotiateAccess,
+			wantOk:          false,
+		},
+		{
+			name:            "no recognized challenge is a no-op",
+			current:         BasicAccess,
+			wwwAuthenticate: nil,
+			wantMode:        BasicAccess,
+			wantOk:          false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMode, gotOk := NextAccessMode(tt.current, tt.wwwAuthenticate)
+			if gotMode != tt.wantMode || gotOk != tt.wantOk {
+				t.Errorf("NextAccessMode(%q, %v) = (%q, %v), want (%q, %v)",
+					tt.current, tt.wwwAuthenticate, gotMode, gotOk, tt.wantMode, tt.wantOk)
+			}
+		})
+	}
+}